@@ -0,0 +1,36 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/phoreproject/obp-search-engine/crawling"
+)
+
+// BenchmarkBulkAddItems seeds 100k items for a single owner per
+// iteration, exercising the chunked multi-row INSERT path. Run with
+// `go test -bench` against a real database configured via
+// MYSQL_TEST_DSN or POSTGRES_TEST_DSN; skipped otherwise.
+func BenchmarkBulkAddItems(b *testing.B) {
+	const seedSize = 100000
+
+	for driverName, store := range testDatastores(b) {
+		driverName, store := driverName, store
+		b.Run(driverName, func(b *testing.B) {
+			items := make([]crawling.Item, seedSize)
+			for i := range items {
+				items[i] = crawling.Item{Hash: fmt.Sprintf("bench-%d", i)}
+			}
+			ctx := context.Background()
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				owner := fmt.Sprintf("bench-owner-%d", i)
+				if err := store.BulkAddItems(ctx, []OwnerItems{{Owner: owner, Items: items}}); err != nil {
+					b.Fatalf("BulkAddItems: %v", err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,206 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// dialect hides the SQL syntax differences between the backends
+// SQLDatastore supports, so the query bodies in mysql.go can stay
+// backend-agnostic.
+type dialect interface {
+	// name identifies the dialect, e.g. for goose.SetDialect.
+	name() string
+
+	// upsertNodeTimestampSQL inserts a node with only its namespace, id,
+	// and lastUpdated columns set, bumping lastUpdated on conflict.
+	upsertNodeTimestampSQL() string
+
+	// insertIgnoreNodeSQL inserts a placeholder node, doing nothing if
+	// one with the same namespace and id already exists.
+	insertIgnoreNodeSQL() string
+
+	// upsertNodeSQL inserts or updates a node's full profile.
+	upsertNodeSQL() string
+
+	// getNextNodeSQL selects the least recently updated node within a
+	// namespace.
+	getNextNodeSQL() string
+
+	// bulkUpsertItemSQL inserts or updates rowCount item rows in a
+	// single multi-row INSERT ... VALUES (...), (...), ... statement.
+	bulkUpsertItemSQL(rowCount int) string
+
+	// deleteItemsByOwnersSQL deletes every item belonging to any of n
+	// owners within a single namespace.
+	deleteItemsByOwnersSQL(n int) string
+
+	// getNodeSQL selects a single node by namespace and id.
+	getNodeSQL() string
+
+	// placeholder returns the parameter marker for the n-th argument of
+	// a query (1-indexed), e.g. "?" for MySQL or "$1"/"$2"/... for
+	// PostgreSQL.
+	placeholder(n int) string
+
+	// matchSQL returns a boolean expression that is true when the
+	// items row matches the full-text query bound to placeholder.
+	matchSQL(placeholder string) string
+
+	// rankSQL returns a relevance score for the items row against the
+	// full-text query bound to placeholder, for use in ORDER BY.
+	rankSQL(placeholder string) string
+}
+
+// mysqlDialect targets MySQL/MariaDB using `?` placeholders and
+// ON DUPLICATE KEY UPDATE.
+type mysqlDialect struct{}
+
+func (mysqlDialect) name() string { return "mysql" }
+
+func (mysqlDialect) upsertNodeTimestampSQL() string {
+	return "INSERT INTO nodes (namespace, id, lastUpdated) VALUES (?, ?, NOW()) ON DUPLICATE KEY UPDATE lastUpdated=NOW()"
+}
+
+func (mysqlDialect) insertIgnoreNodeSQL() string {
+	return "INSERT IGNORE INTO nodes (namespace, id, lastUpdated) VALUES (?, ?, '2000-01-01 00:00:00')"
+}
+
+func (mysqlDialect) upsertNodeSQL() string {
+	return "INSERT INTO nodes (namespace, id, lastUpdated, name, handle, location, nsfw, vendor, moderator, about, shortDescription, followerCount, followingCount, listingCount, postCount, ratingCount, averageRating) VALUES (?, ?, NOW(), ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) ON DUPLICATE KEY UPDATE lastUpdated=NOW(), name=?, handle=?, location=?, nsfw=?, vendor=?, moderator=?, about=?, shortDescription=?, followerCount=?, followingCount=?, listingCount=?, postCount=?, ratingCount=?, averageRating=?"
+}
+
+func (mysqlDialect) getNextNodeSQL() string {
+	return "SELECT id, lastUpdated FROM nodes WHERE namespace=? ORDER BY lastUpdated ASC LIMIT 1"
+}
+
+// bulkUpsertItemSQL relies on MySQL's VALUES(col) syntax to re-read the
+// proposed row on conflict, so the UPDATE clause doesn't need its own
+// set of placeholders no matter how many rows are being inserted.
+func (mysqlDialect) bulkUpsertItemSQL(rowCount int) string {
+	const rowPlaceholders = "(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	rows := make([]string, rowCount)
+	for i := range rows {
+		rows[i] = rowPlaceholders
+	}
+	return "INSERT INTO items (namespace, owner, hash, slug, title, tags, description, thumbnail, language, priceAmount, priceCurrency, categories, nsfw, contractType, rating) VALUES " +
+		strings.Join(rows, ", ") +
+		" ON DUPLICATE KEY UPDATE slug=VALUES(slug), title=VALUES(title), tags=VALUES(tags), description=VALUES(description), thumbnail=VALUES(thumbnail), language=VALUES(language), priceAmount=VALUES(priceAmount), priceCurrency=VALUES(priceCurrency), categories=VALUES(categories), nsfw=VALUES(nsfw), contractType=VALUES(contractType), rating=VALUES(rating)"
+}
+
+func (mysqlDialect) deleteItemsByOwnersSQL(n int) string {
+	placeholders := make([]string, n)
+	for i := range placeholders {
+		placeholders[i] = "?"
+	}
+	return "DELETE FROM items WHERE namespace=? AND owner IN (" + strings.Join(placeholders, ", ") + ")"
+}
+
+func (mysqlDialect) getNodeSQL() string {
+	return "SELECT id, lastUpdated FROM nodes WHERE namespace=? AND id=?"
+}
+
+func (mysqlDialect) placeholder(n int) string { return "?" }
+
+func (mysqlDialect) matchSQL(placeholder string) string {
+	return "MATCH(title, description, tags, categories) AGAINST (" + placeholder + " IN NATURAL LANGUAGE MODE)"
+}
+
+func (mysqlDialect) rankSQL(placeholder string) string {
+	return "MATCH(title, description, tags, categories) AGAINST (" + placeholder + " IN NATURAL LANGUAGE MODE)"
+}
+
+// postgresDialect targets PostgreSQL using `$N` placeholders and
+// ON CONFLICT.
+type postgresDialect struct{}
+
+func (postgresDialect) name() string { return "postgres" }
+
+func (postgresDialect) upsertNodeTimestampSQL() string {
+	return "INSERT INTO nodes (namespace, id, lastUpdated) VALUES ($1, $2, CURRENT_TIMESTAMP) ON CONFLICT (namespace, id) DO UPDATE SET lastUpdated=CURRENT_TIMESTAMP"
+}
+
+func (postgresDialect) insertIgnoreNodeSQL() string {
+	return "INSERT INTO nodes (namespace, id, lastUpdated) VALUES ($1, $2, '2000-01-01 00:00:00') ON CONFLICT DO NOTHING"
+}
+
+// upsertNodeSQL takes the same 30 positional arguments as
+// mysqlDialect.upsertNodeSQL, in the same order, rather than reusing
+// placeholders in the UPDATE clause, so callers can build the argument
+// list identically for both dialects.
+func (postgresDialect) upsertNodeSQL() string {
+	return "INSERT INTO nodes (namespace, id, lastUpdated, name, handle, location, nsfw, vendor, moderator, about, shortDescription, followerCount, followingCount, listingCount, postCount, ratingCount, averageRating) VALUES ($1, $2, CURRENT_TIMESTAMP, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16) ON CONFLICT (namespace, id) DO UPDATE SET lastUpdated=CURRENT_TIMESTAMP, name=$17, handle=$18, location=$19, nsfw=$20, vendor=$21, moderator=$22, about=$23, shortDescription=$24, followerCount=$25, followingCount=$26, listingCount=$27, postCount=$28, ratingCount=$29, averageRating=$30"
+}
+
+func (postgresDialect) getNextNodeSQL() string {
+	return "SELECT id, lastUpdated FROM nodes WHERE namespace=$1 ORDER BY lastUpdated ASC LIMIT 1"
+}
+
+// bulkUpsertItemSQL relies on Postgres's EXCLUDED pseudo-table to
+// re-read the proposed row on conflict, so the UPDATE clause doesn't
+// need its own set of placeholders no matter how many rows are being
+// inserted.
+func (postgresDialect) bulkUpsertItemSQL(rowCount int) string {
+	const columnsPerRow = 15
+	rows := make([]string, rowCount)
+	n := 0
+	for i := range rows {
+		placeholders := make([]string, columnsPerRow)
+		for c := range placeholders {
+			n++
+			placeholders[c] = fmt.Sprintf("$%d", n)
+		}
+		rows[i] = "(" + strings.Join(placeholders, ", ") + ")"
+	}
+	return "INSERT INTO items (namespace, owner, hash, slug, title, tags, description, thumbnail, language, priceAmount, priceCurrency, categories, nsfw, contractType, rating) VALUES " +
+		strings.Join(rows, ", ") +
+		" ON CONFLICT (namespace, hash) DO UPDATE SET slug=EXCLUDED.slug, title=EXCLUDED.title, tags=EXCLUDED.tags, description=EXCLUDED.description, thumbnail=EXCLUDED.thumbnail, language=EXCLUDED.language, priceAmount=EXCLUDED.priceAmount, priceCurrency=EXCLUDED.priceCurrency, categories=EXCLUDED.categories, nsfw=EXCLUDED.nsfw, contractType=EXCLUDED.contractType, rating=EXCLUDED.rating"
+}
+
+func (postgresDialect) deleteItemsByOwnersSQL(n int) string {
+	placeholders := make([]string, n)
+	for i := range placeholders {
+		placeholders[i] = fmt.Sprintf("$%d", i+2)
+	}
+	return "DELETE FROM items WHERE namespace=$1 AND owner IN (" + strings.Join(placeholders, ", ") + ")"
+}
+
+func (postgresDialect) getNodeSQL() string {
+	return "SELECT id, lastUpdated FROM nodes WHERE namespace=$1 AND id=$2"
+}
+
+func (postgresDialect) placeholder(n int) string { return fmt.Sprintf("$%d", n) }
+
+func (postgresDialect) matchSQL(placeholder string) string {
+	return "searchVector @@ plainto_tsquery('english', " + placeholder + ")"
+}
+
+func (postgresDialect) rankSQL(placeholder string) string {
+	return "ts_rank_cd(searchVector, plainto_tsquery('english', " + placeholder + "))"
+}
+
+// dialectFor returns the dialect matching driverName, e.g. "mysql" or
+// "postgres".
+func dialectFor(driverName string) (dialect, error) {
+	switch driverName {
+	case "mysql":
+		return mysqlDialect{}, nil
+	case "postgres":
+		return postgresDialect{}, nil
+	default:
+		return nil, fmt.Errorf("db: unsupported driver %q", driverName)
+	}
+}
+
+// detectDriverName infers a driver name from the concrete type of the
+// connection's driver.Driver, so callers don't have to pass one
+// explicitly when it can be determined automatically.
+func detectDriverName(conn *sql.DB) string {
+	switch fmt.Sprintf("%T", conn.Driver()) {
+	case "*pq.Driver", "*stdlib.Driver":
+		return "postgres"
+	default:
+		return "mysql"
+	}
+}
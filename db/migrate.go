@@ -0,0 +1,59 @@
+package db
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+
+	"github.com/pressly/goose"
+
+	// registers the embedded migrations with goose as a side effect
+	_ "github.com/phoreproject/obp-search-engine/db/migrations"
+)
+
+// MigrationsDir returns a directory goose can use as its on-disk
+// migration source, creating it if it doesn't already exist. Every
+// migration in this package is registered in Go via goose.AddMigration
+// rather than shipped as a .sql file, but goose.CollectMigrations still
+// os.Stats the directory before it ever looks at the Go registry, so a
+// bare relative path like "migrations" fails outright unless the
+// process happens to be run from a directory that contains one. Callers
+// (EnsureDB and the migrate CLI) should use this instead of a literal.
+func MigrationsDir() (string, error) {
+	dir := filepath.Join(os.TempDir(), "obp-search-engine-migrations")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// EnsureDB opens a *sql.DB for driverName/dataSourceName, sets the goose
+// dialect to match, and brings the schema up to the latest embedded
+// migration before handing the connection back. Callers should use the
+// returned *sql.DB to construct a SQLDatastore rather than opening the
+// database themselves, so the schema is always migrated first.
+func EnsureDB(driverName, dataSourceName string) (*sql.DB, error) {
+	conn, err := sql.Open(driverName, dataSourceName)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := conn.Ping(); err != nil {
+		return nil, err
+	}
+
+	if err := goose.SetDialect(driverName); err != nil {
+		return nil, err
+	}
+
+	dir, err := MigrationsDir()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := goose.Up(conn, dir); err != nil {
+		return nil, err
+	}
+
+	return conn, nil
+}
@@ -0,0 +1,37 @@
+package migrations
+
+import (
+	"database/sql"
+
+	"github.com/pressly/goose"
+)
+
+func init() {
+	goose.AddMigration(upInitialSchema, downInitialSchema)
+}
+
+func upInitialSchema(tx *sql.Tx) error {
+	switch goose.GetDialect().(type) {
+	case *goose.PostgresDialect:
+		if _, err := tx.Exec("CREATE TABLE IF NOT EXISTS nodes (id VARCHAR(50) NOT NULL, lastUpdated TIMESTAMP, name VARCHAR(40), handle VARCHAR(40), location VARCHAR(40), nsfw BOOLEAN, vendor BOOLEAN, moderator BOOLEAN, about VARCHAR(10000), shortDescription VARCHAR(160), followerCount INT, followingCount INT, listingCount INT, postCount INT, ratingCount INT, averageRating DECIMAL(3, 2), listed BOOLEAN DEFAULT FALSE, banned BOOLEAN DEFAULT FALSE, PRIMARY KEY (id))"); err != nil {
+			return err
+		}
+		_, err := tx.Exec("CREATE TABLE IF NOT EXISTS items (owner VARCHAR(50), hash VARCHAR(50) NOT NULL, slug VARCHAR(70), title VARCHAR(140), tags VARCHAR(410), description TEXT, thumbnail VARCHAR(160), language VARCHAR(20), priceAmount BIGINT, priceCurrency VARCHAR(10), categories VARCHAR(410), nsfw BOOLEAN, contractType VARCHAR(20), rating DECIMAL(3, 2), PRIMARY KEY (hash))")
+		return err
+	default:
+		if _, err := tx.Exec("CREATE TABLE IF NOT EXISTS nodes (id VARCHAR(50) NOT NULL, lastUpdated DATETIME, name VARCHAR(40), handle VARCHAR(40), location VARCHAR(40), nsfw TINYINT(1), vendor TINYINT(1), moderator TINYINT(1), about VARCHAR(10000), shortDescription VARCHAR(160), followerCount INT, followingCount INT, listingCount INT, postCount INT, ratingCount INT, averageRating DECIMAL(3, 2), listed TINYINT(1) DEFAULT 0, banned TINYINT(1) DEFAULT 0, PRIMARY KEY (id))"); err != nil {
+			return err
+		}
+		_, err := tx.Exec("CREATE TABLE IF NOT EXISTS items (owner VARCHAR(50), hash VARCHAR(50) NOT NULL, slug VARCHAR(70), title VARCHAR(140), tags VARCHAR(410), description TEXT, thumbnail VARCHAR(160), language VARCHAR(20), priceAmount BIGINT, priceCurrency VARCHAR(10), categories VARCHAR(410), nsfw TINYINT(1), contractType VARCHAR(20), rating DECIMAL(3, 2), PRIMARY KEY (hash))")
+		return err
+	}
+}
+
+func downInitialSchema(tx *sql.Tx) error {
+	_, err := tx.Exec("DROP TABLE IF EXISTS items")
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("DROP TABLE IF EXISTS nodes")
+	return err
+}
@@ -0,0 +1,54 @@
+package migrations
+
+import (
+	"database/sql"
+
+	"github.com/pressly/goose"
+)
+
+func init() {
+	goose.AddMigration(upFullTextSearch, downFullTextSearch)
+}
+
+func upFullTextSearch(tx *sql.Tx) error {
+	switch goose.GetDialect().(type) {
+	case *goose.PostgresDialect:
+		// to_tsvector(regconfig, text) is STABLE, not IMMUTABLE, so Postgres
+		// refuses to use it directly in a GENERATED ALWAYS AS ... STORED
+		// expression. Wrapping it in a SQL function we declare IMMUTABLE
+		// ourselves satisfies the planner; it's safe here because we always
+		// call it with a literal 'english' regconfig.
+		_, err := tx.Exec("CREATE FUNCTION items_search_tsvector(title text, description text, tags text, categories text) RETURNS tsvector AS $$ SELECT to_tsvector('english', coalesce(title, '') || ' ' || coalesce(description, '') || ' ' || coalesce(tags, '') || ' ' || coalesce(categories, '')) $$ LANGUAGE sql IMMUTABLE")
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec("ALTER TABLE items ADD COLUMN searchVector tsvector GENERATED ALWAYS AS (items_search_tsvector(title, description, tags, categories)) STORED")
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec("CREATE INDEX items_search_vector_idx ON items USING GIN (searchVector)")
+		return err
+	default:
+		_, err := tx.Exec("ALTER TABLE items ADD FULLTEXT items_search_idx (title, description, tags, categories)")
+		return err
+	}
+}
+
+func downFullTextSearch(tx *sql.Tx) error {
+	switch goose.GetDialect().(type) {
+	case *goose.PostgresDialect:
+		_, err := tx.Exec("DROP INDEX IF EXISTS items_search_vector_idx")
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec("ALTER TABLE items DROP COLUMN IF EXISTS searchVector")
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec("DROP FUNCTION IF EXISTS items_search_tsvector(text, text, text, text)")
+		return err
+	default:
+		_, err := tx.Exec("ALTER TABLE items DROP INDEX items_search_idx")
+		return err
+	}
+}
@@ -0,0 +1,85 @@
+package migrations
+
+import (
+	"database/sql"
+
+	"github.com/pressly/goose"
+)
+
+// defaultNamespace must match db.DefaultNamespace; it's duplicated here
+// rather than imported to keep migrations free of a dependency on the
+// package they migrate.
+const defaultNamespace = "default"
+
+func init() {
+	goose.AddMigration(upNamespace, downNamespace)
+}
+
+func upNamespace(tx *sql.Tx) error {
+	if _, err := tx.Exec("ALTER TABLE nodes ADD COLUMN namespace VARCHAR(50) NOT NULL DEFAULT '" + defaultNamespace + "'"); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("ALTER TABLE items ADD COLUMN namespace VARCHAR(50) NOT NULL DEFAULT '" + defaultNamespace + "'"); err != nil {
+		return err
+	}
+	// The column defaults above already backfill existing rows, but
+	// state it explicitly so the migration reads correctly on its own.
+	if _, err := tx.Exec("UPDATE nodes SET namespace = '" + defaultNamespace + "' WHERE namespace = ''"); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE items SET namespace = '" + defaultNamespace + "' WHERE namespace = ''"); err != nil {
+		return err
+	}
+
+	switch goose.GetDialect().(type) {
+	case *goose.PostgresDialect:
+		if _, err := tx.Exec("ALTER TABLE nodes DROP CONSTRAINT nodes_pkey"); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("ALTER TABLE nodes ADD PRIMARY KEY (namespace, id)"); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("ALTER TABLE items DROP CONSTRAINT items_pkey"); err != nil {
+			return err
+		}
+		_, err := tx.Exec("ALTER TABLE items ADD PRIMARY KEY (namespace, hash)")
+		return err
+	default:
+		if _, err := tx.Exec("ALTER TABLE nodes DROP PRIMARY KEY, ADD PRIMARY KEY (namespace, id)"); err != nil {
+			return err
+		}
+		_, err := tx.Exec("ALTER TABLE items DROP PRIMARY KEY, ADD PRIMARY KEY (namespace, hash)")
+		return err
+	}
+}
+
+func downNamespace(tx *sql.Tx) error {
+	switch goose.GetDialect().(type) {
+	case *goose.PostgresDialect:
+		if _, err := tx.Exec("ALTER TABLE items DROP CONSTRAINT items_pkey"); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("ALTER TABLE items ADD PRIMARY KEY (hash)"); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("ALTER TABLE nodes DROP CONSTRAINT nodes_pkey"); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("ALTER TABLE nodes ADD PRIMARY KEY (id)"); err != nil {
+			return err
+		}
+	default:
+		if _, err := tx.Exec("ALTER TABLE items DROP PRIMARY KEY, ADD PRIMARY KEY (hash)"); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("ALTER TABLE nodes DROP PRIMARY KEY, ADD PRIMARY KEY (id)"); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec("ALTER TABLE items DROP COLUMN namespace"); err != nil {
+		return err
+	}
+	_, err := tx.Exec("ALTER TABLE nodes DROP COLUMN namespace")
+	return err
+}
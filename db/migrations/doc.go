@@ -0,0 +1,7 @@
+// Package migrations holds the embedded goose migrations for the search
+// engine's SQL schema. Each schema change lives in its own file named
+// <version>_<description>.go and registers itself with goose via
+// goose.AddMigration in an init function, so importing this package for
+// its side effects is enough to make the migrations available to
+// db.EnsureDB and the migrate command.
+package migrations
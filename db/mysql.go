@@ -9,27 +9,61 @@ import (
 	"github.com/phoreproject/obp-search-engine/crawling"
 )
 
-// SQLDatastore represents a datastore for the crawler implemented using Redis
+// defaultBulkChunkSize is the number of item rows BulkAddItems batches
+// into a single multi-row INSERT by default. It keeps each statement
+// comfortably within MySQL's max_allowed_packet and well under
+// PostgreSQL's 65535 bound-parameter limit for the 15-column items
+// table.
+const defaultBulkChunkSize = 500
+
+// DefaultNamespace is the namespace used by rows that predate
+// namespacing, and the implicit namespace for callers that don't need
+// multi-tenancy.
+const DefaultNamespace = "default"
+
+// SQLDatastore represents a datastore for the crawler backed by a MySQL or
+// PostgreSQL database, scoped to a namespace.
 type SQLDatastore struct {
-	db *sql.DB
+	db            *sql.DB
+	driverName    string
+	dialect       dialect
+	namespace     string
+	bulkChunkSize int
 }
 
-// NewSQLDatastore creates a new datastore given MySQL connection info
-func NewSQLDatastore(db *sql.DB) (*SQLDatastore, error) {
-	_, err := db.Exec("CREATE TABLE IF NOT EXISTS nodes (id VARCHAR(50) NOT NULL, lastUpdated DATETIME, name VARCHAR(40), handle VARCHAR(40), location VARCHAR(40), nsfw TINYINT(1), vendor TINYINT(1), moderator TINYINT(1), about VARCHAR(10000), shortDescription VARCHAR(160), followerCount INT, followingCount INT, listingCount INT, postCount INT, ratingCount INT, averageRating DECIMAL(3, 2), listed TINYINT(1) DEFAULT 0, banned TINYINT(1) DEFAULT 0, PRIMARY KEY (id))")
-	if err != nil {
-		return nil, err
-	}
-	_, err = db.Exec("CREATE TABLE IF NOT EXISTS items (owner VARCHAR(50), hash VARCHAR(50) NOT NULL, slug VARCHAR(70), title VARCHAR(140), tags VARCHAR(410), description TEXT, thumbnail VARCHAR(160), language VARCHAR(20), priceAmount BIGINT, priceCurrency VARCHAR(10), categories VARCHAR(410), nsfw TINYINT(1), contractType VARCHAR(20), rating DECIMAL(3, 2), PRIMARY KEY (hash))")
+// NewSQLDatastore creates a new datastore from a connection that has
+// already been migrated to the latest schema, e.g. via EnsureDB, scoped
+// to namespace so it can share the connection and tables with other
+// datastores without their rows colliding. The driver (MySQL or
+// PostgreSQL) is detected from db; use NewSQLDatastoreWithDriver to set
+// it explicitly, e.g. when the driver can't be inferred from its
+// concrete type.
+func NewSQLDatastore(db *sql.DB, namespace string) (*SQLDatastore, error) {
+	return NewSQLDatastoreWithDriver(db, detectDriverName(db), namespace)
+}
+
+// NewSQLDatastoreWithDriver creates a new datastore using the dialect for
+// the given driver name ("mysql" or "postgres") instead of attempting to
+// detect it from db, scoped to namespace.
+func NewSQLDatastoreWithDriver(db *sql.DB, driverName, namespace string) (*SQLDatastore, error) {
+	dialect, err := dialectFor(driverName)
 	if err != nil {
 		return nil, err
 	}
-	return &SQLDatastore{db: db}, nil
+	return &SQLDatastore{db: db, driverName: driverName, dialect: dialect, namespace: namespace, bulkChunkSize: defaultBulkChunkSize}, nil
 }
 
-// GetNextNode gets the next node from the database
-func (d *SQLDatastore) GetNextNode() (*crawling.Node, error) {
-	r := d.db.QueryRow("SELECT id, lastUpdated FROM nodes ORDER BY lastUpdated ASC LIMIT 1")
+// SetBulkChunkSize overrides the number of item rows BulkAddItems
+// batches per multi-row INSERT. It's exposed mainly for tuning against
+// a specific database's packet/parameter limits; the default is safe
+// for both supported backends.
+func (d *SQLDatastore) SetBulkChunkSize(n int) {
+	d.bulkChunkSize = n
+}
+
+// GetNextNode gets the next node from the database within d's namespace
+func (d *SQLDatastore) GetNextNode(ctx context.Context) (*crawling.Node, error) {
+	r := d.db.QueryRowContext(ctx, d.dialect.getNextNodeSQL(), d.namespace)
 	node := crawling.Node{}
 	err := r.Scan(&node.ID, &node.LastCrawled)
 	if err != nil {
@@ -39,19 +73,20 @@ func (d *SQLDatastore) GetNextNode() (*crawling.Node, error) {
 }
 
 // SaveNodeUninitialized saves a node to the database without extra data
-func (d *SQLDatastore) SaveNodeUninitialized(n crawling.Node) error {
-	tx, err := d.db.Begin()
+func (d *SQLDatastore) SaveNodeUninitialized(ctx context.Context, n crawling.Node) error {
+	tx, err := d.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
-	insertStatement, err := tx.Prepare("INSERT INTO nodes (id, lastUpdated) VALUES (?, NOW()) ON DUPLICATE KEY UPDATE lastUpdated=NOW()")
+	insertStatement, err := tx.PrepareContext(ctx, d.dialect.upsertNodeTimestampSQL())
 	if err != nil {
 		return err
 	}
 	defer insertStatement.Close()
 
-	_, err = tx.Stmt(insertStatement).Exec(n.ID)
+	_, err = insertStatement.ExecContext(ctx, d.namespace, n.ID)
 	if err != nil {
 		return err
 	}
@@ -60,19 +95,21 @@ func (d *SQLDatastore) SaveNodeUninitialized(n crawling.Node) error {
 }
 
 // SaveNode saves a node to the database
-func (d *SQLDatastore) SaveNode(n crawling.Node) error {
-	tx, err := d.db.Begin()
+func (d *SQLDatastore) SaveNode(ctx context.Context, n crawling.Node) error {
+	tx, err := d.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
-	insertStatement, err := tx.Prepare("INSERT INTO nodes (id, lastUpdated, name, handle, location, nsfw, vendor, moderator, about, shortDescription, followerCount, followingCount, listingCount, postCount, ratingCount, averageRating) VALUES (?, NOW(), ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) ON DUPLICATE KEY UPDATE lastUpdated=NOW(), name=?, handle=?, location=?, nsfw=?, vendor=?, moderator=?, about=?, shortDescription=?, followerCount=?, followingCount=?, listingCount=?, postCount=?, ratingCount=?, averageRating=?")
+	insertStatement, err := tx.PrepareContext(ctx, d.dialect.upsertNodeSQL())
 	if err != nil {
 		return err
 	}
 	defer insertStatement.Close()
 
-	_, err = tx.Stmt(insertStatement).Exec(
+	_, err = insertStatement.ExecContext(ctx,
+		d.namespace,
 		n.ID,
 		n.Profile.Name,
 		n.Profile.Handle,
@@ -111,20 +148,22 @@ func (d *SQLDatastore) SaveNode(n crawling.Node) error {
 }
 
 // AddUninitializedNodes adds nodes to the queue to be crawled
-func (d *SQLDatastore) AddUninitializedNodes(nodes []crawling.Node) error {
-	tx, err := d.db.Begin()
+func (d *SQLDatastore) AddUninitializedNodes(ctx context.Context, nodes []crawling.Node) error {
+	tx, err := d.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
+
+	insertStatement, err := tx.PrepareContext(ctx, d.dialect.insertIgnoreNodeSQL())
+	if err != nil {
+		return err
+	}
+	defer insertStatement.Close()
+
 	for n := range nodes {
 		fmt.Printf("Added %s\n", nodes[n].ID)
-		insertStatement, err := d.db.Prepare("INSERT IGNORE INTO nodes (id, lastUpdated) VALUES (?, '2000-01-01 00:00:00')")
-		if err != nil {
-			return err
-		}
-		defer insertStatement.Close()
-
-		_, err = tx.Stmt(insertStatement).Exec(nodes[n].ID)
+		_, err = insertStatement.ExecContext(ctx, d.namespace, nodes[n].ID)
 		if err != nil {
 			return err
 		}
@@ -134,13 +173,13 @@ func (d *SQLDatastore) AddUninitializedNodes(nodes []crawling.Node) error {
 }
 
 // GetNode gets a node's information from the datastore
-func (d *SQLDatastore) GetNode(nodeID string) (*crawling.Node, error) {
-	s, err := d.db.Prepare("SELECT id, lastUpdated FROM nodes WHERE id=?")
+func (d *SQLDatastore) GetNode(ctx context.Context, nodeID string) (*crawling.Node, error) {
+	s, err := d.db.PrepareContext(ctx, d.dialect.getNodeSQL())
 	if err != nil {
 		return nil, err
 	}
 	defer s.Close()
-	r := s.QueryRow(nodeID)
+	r := s.QueryRowContext(ctx, d.namespace, nodeID)
 	node := &crawling.Node{}
 	err = r.Scan(&node.ID, &node.LastCrawled)
 	if err != nil {
@@ -149,65 +188,123 @@ func (d *SQLDatastore) GetNode(nodeID string) (*crawling.Node, error) {
 	return node, nil
 }
 
-// AddItemsForNode updates a node with the following items
-func (d *SQLDatastore) AddItemsForNode(owner string, items []crawling.Item) error {
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+// AddItemsForNode replaces owner's items with the given set, within d's
+// namespace.
+func (d *SQLDatastore) AddItemsForNode(ctx context.Context, owner string, items []crawling.Item) error {
+	return d.BulkAddItems(ctx, []OwnerItems{{Owner: owner, Items: items}})
+}
+
+// OwnerItems pairs a node's items with the owner they belong to, so
+// BulkAddItems can replace several nodes' items in one transaction.
+type OwnerItems struct {
+	Owner string
+	Items []crawling.Item
+}
+
+// ownedItem flattens an OwnerItems slice into one row per item, so
+// BulkAddItems can chunk across owner boundaries.
+type ownedItem struct {
+	owner string
+	item  crawling.Item
+}
+
+// BulkAddItems replaces the items for every owner in ownerItems within
+// d's namespace, in a single transaction. Items are inserted with
+// multi-row INSERT ... VALUES (...), (...), ... statements chunked to
+// bulkChunkSize rows, each prepared and executed once for its chunk,
+// instead of one round trip per item. Cancelling ctx aborts the
+// transaction before, or in between, chunks.
+func (d *SQLDatastore) BulkAddItems(ctx context.Context, ownerItems []OwnerItems) error {
 	tx, err := d.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
-	s, err := tx.Prepare("DELETE FROM items WHERE owner = ?")
-	if err != nil {
-		return err
+	defer tx.Rollback()
+
+	owners := make([]interface{}, len(ownerItems)+1)
+	owners[0] = d.namespace
+	for i := range ownerItems {
+		owners[i+1] = ownerItems[i].Owner
+	}
+	if len(ownerItems) > 0 {
+		if err := execOnceContext(ctx, tx, d.dialect.deleteItemsByOwnersSQL(len(ownerItems)), owners...); err != nil {
+			return err
+		}
 	}
-	defer s.Close()
 
-	_, err = s.Exec(owner)
-	if err != nil {
-		return err
+	var items []ownedItem
+	for _, oi := range ownerItems {
+		for _, item := range oi.Items {
+			items = append(items, ownedItem{owner: oi.Owner, item: item})
+		}
 	}
 
-	for i := range items {
-		s, err = tx.Prepare("INSERT INTO items (owner, hash, slug, title, tags, description, thumbnail, language, priceAmount, priceCurrency, categories, nsfw, contractType, rating) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) ON DUPLICATE KEY UPDATE slug=?, title=?, tags=?, description=?, thumbnail=?, language=?, priceAmount=?, priceCurrency=?, categories=?, nsfw=?, contractType=?, rating=?")
-		if err != nil {
+	chunkSize := d.bulkChunkSize
+	if chunkSize <= 0 {
+		chunkSize = defaultBulkChunkSize
+	}
+
+	for start := 0; start < len(items); start += chunkSize {
+		if err := ctx.Err(); err != nil {
 			return err
 		}
-		defer s.Close()
-
-		_, err = s.Exec(
-			owner,
-			items[i].Hash,
-			items[i].Slug,
-			items[i].Title,
-			"",
-			items[i].Description,
-			items[i].Thumbnail.Tiny+","+items[i].Thumbnail.Small+","+items[i].Thumbnail.Medium,
-			items[i].Language,
-			items[i].Price.Amount,
-			items[i].Price.CurrencyCode,
-			strings.Join(items[i].Categories, ","),
-			items[i].NSFW,
-			items[i].ContractType,
-			items[i].AverageRating,
-			items[i].Slug,
-			items[i].Title,
-			"",
-			items[i].Description,
-			items[i].Thumbnail.Tiny+","+items[i].Thumbnail.Small+","+items[i].Thumbnail.Medium,
-			items[i].Language,
-			items[i].Price.Amount,
-			items[i].Price.CurrencyCode,
-			strings.Join(items[i].Categories, ","),
-			items[i].NSFW,
-			items[i].ContractType,
-			items[i].AverageRating,
-		)
-		if err != nil {
+
+		end := start + chunkSize
+		if end > len(items) {
+			end = len(items)
+		}
+		chunk := items[start:end]
+
+		args := make([]interface{}, 0, len(chunk)*15)
+		for _, oi := range chunk {
+			args = append(args,
+				d.namespace,
+				oi.owner,
+				oi.item.Hash,
+				oi.item.Slug,
+				oi.item.Title,
+				strings.Join(oi.item.Tags, ","),
+				oi.item.Description,
+				oi.item.Thumbnail.Tiny+","+oi.item.Thumbnail.Small+","+oi.item.Thumbnail.Medium,
+				oi.item.Language,
+				oi.item.Price.Amount,
+				oi.item.Price.CurrencyCode,
+				categoriesColumn(oi.item.Categories),
+				oi.item.NSFW,
+				oi.item.ContractType,
+				oi.item.AverageRating,
+			)
+		}
+
+		if err := execOnceContext(ctx, tx, d.dialect.bulkUpsertItemSQL(len(chunk)), args...); err != nil {
 			return err
 		}
 	}
 
-	err = tx.Commit()
+	return tx.Commit()
+}
+
+// execOnceContext prepares statement, executes it once with args, and
+// closes it, returning the first error encountered.
+func execOnceContext(ctx context.Context, tx *sql.Tx, statement string, args ...interface{}) error {
+	stmt, err := tx.PrepareContext(ctx, statement)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx, args...)
 	return err
 }
+
+// categoriesColumn joins categories into the stored column value,
+// padding both ends with a comma so SearchItems's Categories filter can
+// match whole categories with a boundary-aware LIKE instead of a raw
+// substring search that would also match e.g. "art" against
+// "Smartphones".
+func categoriesColumn(categories []string) string {
+	if len(categories) == 0 {
+		return ""
+	}
+	return "," + strings.Join(categories, ",") + ","
+}
@@ -0,0 +1,133 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/phoreproject/obp-search-engine/crawling"
+)
+
+// SearchFilters narrows a SearchItems query. A zero-valued field is
+// treated as "don't filter on this".
+type SearchFilters struct {
+	NSFW          *bool
+	ContractType  string
+	PriceMin      *uint64
+	PriceMax      *uint64
+	PriceCurrency string
+	Categories    []string
+}
+
+// SearchItems performs a relevance-ranked full-text search over an
+// item's title, description, tags, and categories, returning the
+// requested page of matches and the total number of items that matched
+// before paging.
+func (d *SQLDatastore) SearchItems(ctx context.Context, query string, filters SearchFilters, page, size int) ([]crawling.Item, int, error) {
+	n := 0
+	nextPlaceholder := func() string {
+		n++
+		return d.dialect.placeholder(n)
+	}
+
+	namespacePlaceholder := nextPlaceholder()
+	matchPlaceholder := nextPlaceholder()
+	conditions := []string{"namespace = " + namespacePlaceholder, d.dialect.matchSQL(matchPlaceholder)}
+	args := []interface{}{d.namespace, query}
+
+	if filters.NSFW != nil {
+		conditions = append(conditions, "nsfw = "+nextPlaceholder())
+		args = append(args, *filters.NSFW)
+	}
+	if filters.ContractType != "" {
+		conditions = append(conditions, "contractType = "+nextPlaceholder())
+		args = append(args, filters.ContractType)
+	}
+	if filters.PriceMin != nil {
+		conditions = append(conditions, "priceAmount >= "+nextPlaceholder())
+		args = append(args, *filters.PriceMin)
+	}
+	if filters.PriceMax != nil {
+		conditions = append(conditions, "priceAmount <= "+nextPlaceholder())
+		args = append(args, *filters.PriceMax)
+	}
+	if filters.PriceCurrency != "" {
+		conditions = append(conditions, "priceCurrency = "+nextPlaceholder())
+		args = append(args, filters.PriceCurrency)
+	}
+	for _, category := range filters.Categories {
+		conditions = append(conditions, "categories LIKE "+nextPlaceholder())
+		args = append(args, "%,"+category+",%")
+	}
+	where := strings.Join(conditions, " AND ")
+
+	var total int
+	countSQL := "SELECT COUNT(*) FROM items WHERE " + where
+	if err := d.db.QueryRowContext(ctx, countSQL, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rankPlaceholder := nextPlaceholder()
+	rankArgs := append(append([]interface{}{}, args...), query)
+	limitPlaceholder := nextPlaceholder()
+	offsetPlaceholder := nextPlaceholder()
+	rankArgs = append(rankArgs, size, page*size)
+
+	selectSQL := fmt.Sprintf(
+		"SELECT hash, slug, title, tags, description, thumbnail, language, priceAmount, priceCurrency, categories, nsfw, contractType, rating FROM items WHERE %s ORDER BY %s DESC LIMIT %s OFFSET %s",
+		where, d.dialect.rankSQL(rankPlaceholder), limitPlaceholder, offsetPlaceholder,
+	)
+
+	rows, err := d.db.QueryContext(ctx, selectSQL, rankArgs...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var items []crawling.Item
+	for rows.Next() {
+		var item crawling.Item
+		var tags, categories, thumbnail string
+		err := rows.Scan(
+			&item.Hash,
+			&item.Slug,
+			&item.Title,
+			&tags,
+			&item.Description,
+			&thumbnail,
+			&item.Language,
+			&item.Price.Amount,
+			&item.Price.CurrencyCode,
+			&categories,
+			&item.NSFW,
+			&item.ContractType,
+			&item.AverageRating,
+		)
+		if err != nil {
+			return nil, 0, err
+		}
+		item.Tags = splitNonEmpty(tags, ",")
+		item.Categories = splitCategories(categories)
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return items, total, nil
+}
+
+// splitNonEmpty is like strings.Split, but returns nil instead of a
+// single empty-string element when s is empty.
+func splitNonEmpty(s, sep string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, sep)
+}
+
+// splitCategories reverses categoriesColumn, trimming the comma padding
+// added there before splitting.
+func splitCategories(s string) []string {
+	return splitNonEmpty(strings.Trim(s, ","), ",")
+}
@@ -0,0 +1,154 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+
+	"github.com/phoreproject/obp-search-engine/crawling"
+)
+
+// testDatastores returns a SQLDatastore for every backend with a DSN
+// configured via MYSQL_TEST_DSN / POSTGRES_TEST_DSN, migrated up and
+// scoped to a namespace unique to this call. A backend is skipped if
+// its DSN isn't set, so `go test ./...` stays hermetic by default; set
+// the env vars to exercise these against real databases.
+func testDatastores(t testing.TB) map[string]*SQLDatastore {
+	t.Helper()
+	stores := map[string]*SQLDatastore{}
+	for driverName, envVar := range map[string]string{
+		"mysql":    "MYSQL_TEST_DSN",
+		"postgres": "POSTGRES_TEST_DSN",
+	} {
+		dsn := os.Getenv(envVar)
+		if dsn == "" {
+			continue
+		}
+
+		conn, err := EnsureDB(driverName, dsn)
+		if err != nil {
+			t.Fatalf("EnsureDB(%q): %v", driverName, err)
+		}
+		t.Cleanup(func() { conn.Close() })
+
+		namespace := fmt.Sprintf("test_%d", time.Now().UnixNano())
+		store, err := NewSQLDatastoreWithDriver(conn, driverName, namespace)
+		if err != nil {
+			t.Fatalf("NewSQLDatastoreWithDriver(%q): %v", driverName, err)
+		}
+		stores[driverName] = store
+	}
+	if len(stores) == 0 {
+		t.Skip("no MYSQL_TEST_DSN or POSTGRES_TEST_DSN set; skipping integration test")
+	}
+	return stores
+}
+
+func TestNodeLifecycle(t *testing.T) {
+	for driverName, store := range testDatastores(t) {
+		driverName, store := driverName, store
+		t.Run(driverName, func(t *testing.T) {
+			ctx := context.Background()
+			node := crawling.Node{ID: "node-1"}
+
+			if err := store.SaveNodeUninitialized(ctx, node); err != nil {
+				t.Fatalf("SaveNodeUninitialized: %v", err)
+			}
+
+			got, err := store.GetNode(ctx, node.ID)
+			if err != nil {
+				t.Fatalf("GetNode: %v", err)
+			}
+			if got.ID != node.ID {
+				t.Fatalf("GetNode returned id %q, want %q", got.ID, node.ID)
+			}
+
+			next, err := store.GetNextNode(ctx)
+			if err != nil {
+				t.Fatalf("GetNextNode: %v", err)
+			}
+			if next.ID != node.ID {
+				t.Fatalf("GetNextNode returned id %q, want %q", next.ID, node.ID)
+			}
+		})
+	}
+}
+
+func TestNamespaceIsolation(t *testing.T) {
+	for driverName, store := range testDatastores(t) {
+		driverName, store := driverName, store
+		t.Run(driverName, func(t *testing.T) {
+			ctx := context.Background()
+
+			other, err := NewSQLDatastoreWithDriver(store.db, driverName, store.namespace+"_other")
+			if err != nil {
+				t.Fatalf("NewSQLDatastoreWithDriver: %v", err)
+			}
+
+			if err := other.AddUninitializedNodes(ctx, []crawling.Node{{ID: "other-namespace-node"}}); err != nil {
+				t.Fatalf("AddUninitializedNodes: %v", err)
+			}
+
+			if _, err := store.GetNode(ctx, "other-namespace-node"); err != sql.ErrNoRows {
+				t.Fatalf("GetNode found a node belonging to another namespace (err=%v)", err)
+			}
+		})
+	}
+}
+
+func TestSearchItemsCategoryBoundary(t *testing.T) {
+	for driverName, store := range testDatastores(t) {
+		driverName, store := driverName, store
+		t.Run(driverName, func(t *testing.T) {
+			ctx := context.Background()
+
+			item := crawling.Item{
+				Hash:       "category-boundary-item",
+				Title:      "a phone",
+				Categories: []string{"Smartphones"},
+			}
+			if err := store.AddItemsForNode(ctx, "category-boundary-owner", []crawling.Item{item}); err != nil {
+				t.Fatalf("AddItemsForNode: %v", err)
+			}
+
+			_, total, err := store.SearchItems(ctx, "phone", SearchFilters{Categories: []string{"art"}}, 0, 10)
+			if err != nil {
+				t.Fatalf("SearchItems: %v", err)
+			}
+			if total != 0 {
+				t.Fatalf("filtering on category %q matched %q, a substring-only hit; got %d results, want 0", "art", "Smartphones", total)
+			}
+		})
+	}
+}
+
+func TestBulkAddItemsCancellationDoesNotLeakConnections(t *testing.T) {
+	for driverName, store := range testDatastores(t) {
+		driverName, store := driverName, store
+		t.Run(driverName, func(t *testing.T) {
+			store.db.SetMaxOpenConns(1)
+
+			for i := 0; i < 5; i++ {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+
+				items := []crawling.Item{{Hash: fmt.Sprintf("cancel-%d-%d", i, time.Now().UnixNano())}}
+				if err := store.BulkAddItems(ctx, []OwnerItems{{Owner: "cancel-owner", Items: items}}); err == nil {
+					t.Fatalf("BulkAddItems with an already-cancelled context returned no error")
+				}
+			}
+
+			probeCtx, probeCancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer probeCancel()
+			if _, err := store.GetNode(probeCtx, "does-not-exist"); err != sql.ErrNoRows {
+				t.Fatalf("GetNode after repeated cancellation: %v (the connection pool may be exhausted by a leaked transaction)", err)
+			}
+		})
+	}
+}
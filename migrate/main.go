@@ -0,0 +1,50 @@
+// Command migrate inspects, applies, and rolls back the search engine's
+// database schema using the goose migrations embedded in db/migrations.
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"log"
+
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+	"github.com/pressly/goose"
+
+	"github.com/phoreproject/obp-search-engine/db"
+)
+
+func main() {
+	driverName := flag.String("driver", "mysql", "database driver (mysql or postgres)")
+	dataSourceName := flag.String("dsn", "root@tcp(127.0.0.1:3306)/obpsearch", "data source name used to connect to the database")
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		log.Fatal("usage: migrate [-driver=mysql|postgres] [-dsn=...] up|down|redo|status|version")
+	}
+
+	// Open the connection without db.EnsureDB, which would migrate up to
+	// latest before the requested command runs.
+	conn, err := sql.Open(*driverName, *dataSourceName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer conn.Close()
+
+	if err := conn.Ping(); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := goose.SetDialect(*driverName); err != nil {
+		log.Fatal(err)
+	}
+
+	dir, err := db.MigrationsDir()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := goose.Run(flag.Arg(0), conn, dir); err != nil {
+		log.Fatal(err)
+	}
+}